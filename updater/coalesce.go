@@ -0,0 +1,138 @@
+package updater
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/hekmon/btblocklist/updater/format"
+)
+
+// ipRange is an inclusive [start, end] address range, kept as a big.Int so
+// both IPv4 and IPv6 addresses can be compared and merged the same way.
+type ipRange struct {
+	start *big.Int
+	end   *big.Int
+	v4    bool
+	label string
+}
+
+// coalesceRecords sorts records by start address and merges every
+// overlapping or directly adjacent range into the minimal covering set of
+// CIDRs, concatenating the merged entries' labels (e.g.
+// "RIPE:foo + spamhaus") so provenance is not lost.
+func coalesceRecords(records []format.Record) (coalesced []format.Record, err error) {
+	if len(records) == 0 {
+		return records, nil
+	}
+	ranges := make([]ipRange, 0, len(records))
+	for _, record := range records {
+		_, network, err := net.ParseCIDR(record.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse %q: %w", record.CIDR, err)
+		}
+		ones, bits := network.Mask.Size()
+		start := ipToInt(network.IP)
+		size := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(bits-ones)), big.NewInt(1))
+		ranges = append(ranges, ipRange{
+			start: start,
+			end:   new(big.Int).Add(start, size),
+			v4:    network.IP.To4() != nil,
+			label: record.Label,
+		})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		if ranges[i].v4 != ranges[j].v4 {
+			return ranges[i].v4
+		}
+		return ranges[i].start.Cmp(ranges[j].start) < 0
+	})
+	merged := make([]ipRange, 0, len(ranges))
+	current := ranges[0]
+	for _, next := range ranges[1:] {
+		gap := new(big.Int).Sub(next.start, current.end)
+		if current.v4 == next.v4 && gap.Cmp(big.NewInt(1)) <= 0 {
+			// overlapping or directly adjacent: extend the current range
+			if next.end.Cmp(current.end) > 0 {
+				current.end = next.end
+			}
+			if !strings.Contains(current.label, next.label) {
+				current.label = current.label + " + " + next.label
+			}
+			continue
+		}
+		merged = append(merged, current)
+		current = next
+	}
+	merged = append(merged, current)
+	for _, r := range merged {
+		cidrs, err := rangeToCIDRs(r.start, r.end, r.v4)
+		if err != nil {
+			return nil, err
+		}
+		for _, cidr := range cidrs {
+			coalesced = append(coalesced, format.Record{Label: r.label, CIDR: cidr})
+		}
+	}
+	return coalesced, nil
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	if v4 := ip.To4(); v4 != nil {
+		return new(big.Int).SetBytes(v4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func intToIP(i *big.Int, v4 bool) net.IP {
+	size := 16
+	if v4 {
+		size = 4
+	}
+	raw := i.Bytes()
+	buf := make([]byte, size)
+	copy(buf[size-len(raw):], raw)
+	return net.IP(buf)
+}
+
+// rangeToCIDRs expands the inclusive [start, end] range into the minimal
+// set of CIDR blocks covering it exactly.
+func rangeToCIDRs(start, end *big.Int, v4 bool) (cidrs []string, err error) {
+	bits := 128
+	if v4 {
+		bits = 32
+	}
+	one := big.NewInt(1)
+	cur := new(big.Int).Set(start)
+	for cur.Cmp(end) <= 0 {
+		remaining := new(big.Int).Add(new(big.Int).Sub(end, cur), one)
+		maxBlockBits := remaining.BitLen() - 1
+		alignBits := trailingZeroBits(cur, bits)
+		size := alignBits
+		if maxBlockBits < size {
+			size = maxBlockBits
+		}
+		if size < 0 {
+			size = 0
+		}
+		cidrs = append(cidrs, fmt.Sprintf("%s/%d", intToIP(cur, v4), bits-size))
+		cur.Add(cur, new(big.Int).Lsh(one, uint(size)))
+	}
+	return cidrs, nil
+}
+
+// trailingZeroBits returns how many low-order bits of i are zero, capped
+// at maxBits. This tells us the largest power-of-two block that starts at
+// address i without needing to realign.
+func trailingZeroBits(i *big.Int, maxBits int) int {
+	if i.Sign() == 0 {
+		return maxBits
+	}
+	n := 0
+	for n < maxBits && i.Bit(n) == 0 {
+		n++
+	}
+	return n
+}
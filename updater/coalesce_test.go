@@ -0,0 +1,109 @@
+package updater
+
+import (
+	"math/big"
+	"net"
+	"testing"
+)
+
+func TestTrailingZeroBits(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   int64
+		maxBits int
+		want    int
+	}{
+		{"zero is fully aligned", 0, 32, 32},
+		{"odd value has no trailing zero", 1, 32, 0},
+		{"power of two", 8, 32, 3},
+		{"alignment capped at maxBits", 0, 4, 4},
+		{"single low bit set among high bits", 0b10100, 32, 2},
+		{"all bits set", 0b1111, 4, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trailingZeroBits(big.NewInt(tt.value), tt.maxBits)
+			if got != tt.want {
+				t.Errorf("trailingZeroBits(%d, %d) = %d, want %d", tt.value, tt.maxBits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeToCIDRs(t *testing.T) {
+	tests := []struct {
+		name  string
+		start string
+		end   string
+		v4    bool
+		want  []string
+	}{
+		{
+			name:  "single address",
+			start: "192.0.2.1",
+			end:   "192.0.2.1",
+			v4:    true,
+			want:  []string{"192.0.2.1/32"},
+		},
+		{
+			name:  "aligned /24",
+			start: "192.0.2.0",
+			end:   "192.0.2.255",
+			v4:    true,
+			want:  []string{"192.0.2.0/24"},
+		},
+		{
+			name:  "misaligned start splits into multiple blocks",
+			start: "192.0.2.1",
+			end:   "192.0.2.2",
+			v4:    true,
+			want:  []string{"192.0.2.1/32", "192.0.2.2/32"},
+		},
+		{
+			name:  "misaligned end below a full block",
+			start: "192.0.2.0",
+			end:   "192.0.2.2",
+			v4:    true,
+			want:  []string{"192.0.2.0/31", "192.0.2.2/32"},
+		},
+		{
+			name:  "eight addresses straddling a /29 boundary",
+			start: "192.0.2.4",
+			end:   "192.0.2.11",
+			v4:    true,
+			want:  []string{"192.0.2.4/30", "192.0.2.8/30"},
+		},
+		{
+			name:  "ipv6 single address",
+			start: "2001:db8::1",
+			end:   "2001:db8::1",
+			v4:    false,
+			want:  []string{"2001:db8::1/128"},
+		},
+		{
+			name:  "ipv6 aligned /127",
+			start: "2001:db8::",
+			end:   "2001:db8::1",
+			v4:    false,
+			want:  []string{"2001:db8::/127"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := ipToInt(net.ParseIP(tt.start))
+			end := ipToInt(net.ParseIP(tt.end))
+			got, err := rangeToCIDRs(start, end, tt.v4)
+			if err != nil {
+				t.Fatalf("rangeToCIDRs() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("rangeToCIDRs() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("rangeToCIDRs()[%d] = %s, want %s", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package updater
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/hekmon/btblocklist/updater/format"
+)
+
+// Encoding identifies one of the Content-Encoding values this package knows
+// how to produce.
+type Encoding string
+
+// Supported encodings. When a client accepts several of them with the same
+// weight, the one it lists first is used.
+const (
+	EncodingIdentity Encoding = "identity"
+	EncodingGzip     Encoding = "gzip"
+	EncodingZstd     Encoding = "zstd"
+	EncodingBrotli   Encoding = "br"
+)
+
+// CompressionLevels holds the per-codec level to use when building the
+// cached variants. A zero value falls back to that codec's own best
+// compression setting.
+type CompressionLevels struct {
+	Gzip   int
+	Zstd   int
+	Brotli int
+}
+
+// encode compresses raw with encoding, using level as configured in levels.
+// EncodingIdentity returns raw unchanged.
+func encode(raw []byte, encoding Encoding, levels CompressionLevels) (data []byte, err error) {
+	switch encoding {
+	case EncodingIdentity:
+		return raw, nil
+	case EncodingGzip:
+		buf := bufferPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer bufferPool.Put(buf)
+		var compressor *gzip.Writer
+		if levels.Gzip == 0 {
+			// Common case: reuse a pooled writer at the default best-compression
+			// level instead of allocating a fresh one every batch.
+			compressor = gzipWriterPool.Get().(*gzip.Writer)
+			compressor.Reset(buf)
+			defer gzipWriterPool.Put(compressor)
+		} else {
+			var err error
+			if compressor, err = gzip.NewWriterLevel(buf, levels.Gzip); err != nil {
+				return nil, fmt.Errorf("can't create the gzip compressor: %w", err)
+			}
+		}
+		if _, err = compressor.Write(raw); err != nil {
+			return nil, fmt.Errorf("can't write to the gzip compressor: %w", err)
+		}
+		if err = compressor.Close(); err != nil {
+			return nil, fmt.Errorf("can't flush the gzip compressor: %w", err)
+		}
+		return append([]byte(nil), buf.Bytes()...), nil
+	case EncodingZstd:
+		opts := []zstd.EOption{zstd.WithEncoderLevel(zstd.SpeedBestCompression)}
+		if levels.Zstd != 0 {
+			opts = []zstd.EOption{zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(levels.Zstd))}
+		}
+		compressor, err := zstd.NewWriter(nil, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("can't create the zstd compressor: %w", err)
+		}
+		defer compressor.Close()
+		return compressor.EncodeAll(raw, nil), nil
+	case EncodingBrotli:
+		level := levels.Brotli
+		if level == 0 {
+			level = brotli.BestCompression
+		}
+		buf := bytes.NewBuffer(nil)
+		compressor := brotli.NewWriterLevel(buf, level)
+		if _, err = compressor.Write(raw); err != nil {
+			return nil, fmt.Errorf("can't write to the brotli compressor: %w", err)
+		}
+		if err = compressor.Close(); err != nil {
+			return nil, fmt.Errorf("can't flush the brotli compressor: %w", err)
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+	}
+}
+
+// supportedEncodings lists every Encoding this package can produce.
+var supportedEncodings = map[Encoding]bool{
+	EncodingIdentity: true,
+	EncodingGzip:     true,
+	EncodingZstd:     true,
+	EncodingBrotli:   true,
+}
+
+// negotiateEncoding picks the best Encoding both advertised by acceptEncoding
+// (the raw value of an HTTP Accept-Encoding header) and supported by this
+// package, falling back to EncodingIdentity when nothing matches.
+func negotiateEncoding(acceptEncoding string) Encoding {
+	if acceptEncoding == "" {
+		return EncodingIdentity
+	}
+	type candidate struct {
+		encoding Encoding
+		q        float64
+	}
+	candidates := make([]candidate, 0, 4)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.Split(part, ";")
+		q := 1.0
+		for _, param := range fields[1:] {
+			value, found := strings.CutPrefix(strings.TrimSpace(param), "q=")
+			if !found {
+				continue
+			}
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			encoding: Encoding(strings.TrimSpace(fields[0])),
+			q:        q,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, cand := range candidates {
+		if cand.encoding == "*" {
+			return EncodingGzip
+		}
+		if supportedEncodings[cand.encoding] {
+			return cand.encoding
+		}
+	}
+	return EncodingIdentity
+}
+
+// GetEncoded returns an independent reader over the cached payload for
+// kind, encoded for the best codec acceptEncoding (an HTTP Accept-Encoding
+// header value) advertises, building and caching that variant on first
+// use. Callers must Close the returned reader. Small payloads stream from
+// a pooled buffer; payloads over streamingThreshold stream from a
+// memory-mapped temp file so the full content is never copied into the
+// response path.
+//
+// Building a variant never holds compressedDataAccess: only the cache
+// lookup and the final store do. Concurrent cold misses for the same
+// (kind, encoding) are coalesced through buildGroup instead, so one slow
+// compression only blocks requests for that exact pair, and two racing
+// misses never spill two temp files for the same variant.
+func (c *Controller) GetEncoded(kind format.Kind, acceptEncoding string) (body io.ReadCloser, encoding Encoding, err error) {
+	c.compressedDataAccess.RLock()
+	raw, known := c.rawData[kind]
+	encoding = negotiateEncoding(acceptEncoding)
+	blob, cached := c.encodedVariants[kind][encoding]
+	c.compressedDataAccess.RUnlock()
+	if !cached {
+		if !known {
+			return nil, EncodingIdentity, fmt.Errorf("no data cached yet for format '%s'", kind)
+		}
+		if blob, err = c.buildEncodedVariant(kind, encoding, raw); err != nil {
+			return nil, EncodingIdentity, err
+		}
+	}
+	if body, err = blob.reader(); err != nil {
+		return nil, EncodingIdentity, err
+	}
+	return body, encoding, nil
+}
+
+// buildEncodedVariant compresses raw for kind/encoding and caches the
+// result, coalescing concurrent callers for the same (kind, encoding) pair
+// onto a single build via c.buildGroup so they share one compression pass
+// and one spill file instead of racing duplicates of both.
+func (c *Controller) buildEncodedVariant(kind format.Kind, encoding Encoding, raw []byte) (cachedBlob, error) {
+	key := string(kind) + "|" + string(encoding)
+	result, err, _ := c.buildGroup.Do(key, func() (interface{}, error) {
+		c.compressedDataAccess.RLock()
+		blob, cached := c.encodedVariants[kind][encoding]
+		c.compressedDataAccess.RUnlock()
+		if cached {
+			return blob, nil
+		}
+		data, err := encode(raw, encoding, c.compressionLevels)
+		if err != nil {
+			return cachedBlob{}, err
+		}
+		blob, err = newCachedBlob(data)
+		if err != nil {
+			return cachedBlob{}, err
+		}
+		c.compressedDataAccess.Lock()
+		if c.encodedVariants[kind] == nil {
+			c.encodedVariants[kind] = make(map[Encoding]cachedBlob, len(supportedEncodings))
+		}
+		c.encodedVariants[kind][encoding] = blob
+		c.compressedDataAccess.Unlock()
+		if c.metrics != nil {
+			c.metrics.CompressedSize.WithLabelValues(string(kind), string(encoding)).Set(float64(blob.size))
+		}
+		return blob, nil
+	})
+	if err != nil {
+		return cachedBlob{}, err
+	}
+	return result.(cachedBlob), nil
+}
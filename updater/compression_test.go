@@ -0,0 +1,32 @@
+package updater
+
+import "testing"
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		want           Encoding
+	}{
+		{"empty header", "", EncodingIdentity},
+		{"single supported encoding", "gzip", EncodingGzip},
+		{"unsupported encoding falls back to identity", "compress", EncodingIdentity},
+		{"picks highest q-value", "gzip;q=0.5, br;q=0.8", EncodingBrotli},
+		{"ties keep the first listed candidate", "zstd;q=0.5, br;q=0.5", EncodingZstd},
+		{"zero q-value is excluded", "gzip;q=0, br;q=0.1", EncodingBrotli},
+		{"malformed q-value falls back to 1.0", "gzip;q=nope", EncodingGzip},
+		{"unsupported encoding is skipped in favor of a supported one", "compress;q=0.9, gzip;q=0.5", EncodingGzip},
+		{"wildcard maps to gzip", "*", EncodingGzip},
+		{"wildcard only used if nothing supported ranks higher", "identity;q=0.1, *;q=0.2", EncodingGzip},
+		{"whitespace around values is trimmed", " gzip ; q=0.9 , br ; q=0.8 ", EncodingGzip},
+		{"all candidates rejected falls back to identity", "compress, x-custom;q=0.5", EncodingIdentity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := negotiateEncoding(tt.acceptEncoding)
+			if got != tt.want {
+				t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.want)
+			}
+		})
+	}
+}
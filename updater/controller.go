@@ -0,0 +1,172 @@
+package updater
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"github.com/hekmon/btblocklist/updater/format"
+	"github.com/hekmon/btblocklist/updater/metrics"
+)
+
+// Logger is the minimal leveled logging interface the updater subsystem
+// needs from whatever logger the caller wires in.
+type Logger interface {
+	Debug(args ...interface{})
+	Debugf(format string, args ...interface{})
+	Info(args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// RIPERange is the minimal range data the updater needs from whatever RIPE
+// search client is wired in. It is defined locally, rather than importing
+// the ripe package's own type, so this package only depends on the shape
+// of the data and not on the ripe client's implementation.
+type RIPERange struct {
+	Name  string
+	Range string // a CIDR, e.g. "1.2.3.0/24"
+}
+
+// ripeSearcher is satisfied by an adapter around the RIPE search client.
+type ripeSearcher interface {
+	Search(search string) (ranges []RIPERange, err error)
+}
+
+// Config holds every Controller dependency and tunable.
+type Config struct {
+	Context    context.Context
+	Logger     Logger
+	Frequency  time.Duration
+	Blocklists map[string]*url.URL
+	Client     *http.Client
+
+	RIPE       ripeSearcher
+	RIPESearch string // the RIPE search query used to find the ranges to block
+
+	Formatters        []format.Formatter
+	CompressionLevels CompressionLevels
+	DisableCoalescing bool
+
+	Metrics      *metrics.Metrics
+	StatusUpdate func(status string) error
+}
+
+// Controller runs the periodic update loop: it probes RIPE and every
+// configured external blocklist, renders the merged result through every
+// configured Formatter, and keeps the compressed variants consumers fetch
+// through GetEncoded / ServeHTTP up to date.
+type Controller struct {
+	ctx        context.Context
+	logger     Logger
+	frequency  time.Duration
+	blocklists map[string]*url.URL
+	client     *http.Client
+
+	ripe       ripeSearcher
+	ripeSearch string
+
+	formatters        []format.Formatter
+	compressionLevels CompressionLevels
+	disableCoalescing bool
+
+	metrics      *metrics.Metrics
+	statusUpdate func(status string) error
+
+	ripeState      []format.Record
+	externalStates map[string]externalSourceState
+
+	compressedDataAccess sync.RWMutex
+	rawData              map[format.Kind][]byte
+	encodedVariants      map[format.Kind]map[Encoding]cachedBlob
+	// buildGroup coalesces concurrent cold-cache builds of the same
+	// (kind, encoding) variant (see buildEncodedVariant) so a slow
+	// compression pass only serializes requests for that exact pair
+	// instead of every request the Controller serves.
+	buildGroup singleflight.Group
+
+	// batchStateAccess guards lastBatch, lastSuccess and lastUpdate: written
+	// by the updater goroutine once per batch, and read from arbitrary
+	// HTTP-serving goroutines (see LastSuccess, used by /healthz).
+	batchStateAccess sync.RWMutex
+	lastBatch        time.Time
+	lastSuccess      time.Time
+	lastUpdate       time.Time
+}
+
+// New creates a Controller wired per cfg and starts its background update
+// loop; cancel cfg.Context to stop it.
+func New(cfg Config) *Controller {
+	c := &Controller{
+		ctx:               cfg.Context,
+		logger:            cfg.Logger,
+		frequency:         cfg.Frequency,
+		blocklists:        cfg.Blocklists,
+		client:            cfg.Client,
+		ripe:              cfg.RIPE,
+		ripeSearch:        cfg.RIPESearch,
+		formatters:        cfg.Formatters,
+		compressionLevels: cfg.CompressionLevels,
+		disableCoalescing: cfg.DisableCoalescing,
+		metrics:           cfg.Metrics,
+		statusUpdate:      cfg.StatusUpdate,
+		externalStates:    make(map[string]externalSourceState, len(cfg.Blocklists)),
+		rawData:           make(map[format.Kind][]byte, len(cfg.Formatters)),
+		encodedVariants:   make(map[format.Kind]map[Encoding]cachedBlob, len(cfg.Formatters)),
+	}
+	go c.updater()
+	return c
+}
+
+// updateRipe refreshes ripeState from the RIPE search API. changed reports
+// whether the result differs from the previous batch; ok reports whether
+// the search itself succeeded, regardless of whether the result changed,
+// so callers can tell an upstream that simply hasn't changed lately from
+// one that is actually failing.
+func (c *Controller) updateRipe() (changed, ok bool) {
+	searchStart := time.Now()
+	ranges, err := c.ripe.Search(c.ripeSearch)
+	if c.metrics != nil {
+		c.metrics.RIPEQueryDuration.Observe(time.Since(searchStart).Seconds())
+	}
+	if err != nil {
+		c.logger.Errorf("[Updater] RIPE search failed: %v", err)
+		return false, false
+	}
+	records := make([]format.Record, 0, len(ranges))
+	for _, r := range ranges {
+		records = append(records, format.Record{Label: "RIPE:" + r.Name, CIDR: r.Range})
+	}
+	if recordSlicesEqual(c.ripeState, records) {
+		return false, true
+	}
+	c.ripeState = records
+	return true, true
+}
+
+// LastSuccess returns the timestamp of the last batch where at least one
+// source (RIPE or an external blocklist) was fetched successfully,
+// regardless of whether its content had actually changed. Unlike a tick
+// merely occurring, this goes stale when every source fetch is failing,
+// which is what /healthz (see Mux) is meant to catch.
+func (c *Controller) LastSuccess() time.Time {
+	c.batchStateAccess.RLock()
+	defer c.batchStateAccess.RUnlock()
+	return c.lastSuccess
+}
+
+func recordSlicesEqual(a, b []format.Record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,156 @@
+package updater
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// cachedExternalEntry is the sidecar metadata persisted next to a cached
+// external blocklist payload.
+type cachedExternalEntry struct {
+	ETag         string
+	LastModified string
+	Hash         string
+}
+
+// xdgCacheDir returns the directory external blocklist payloads and their
+// fetch metadata are persisted in, creating it if it does not exist yet.
+func xdgCacheDir() (dir string, err error) {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("can't determine the user's home directory: %w", err)
+		}
+		base = filepath.Join(home, ".cache")
+	}
+	dir = filepath.Join(base, "btblocklist")
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("can't create the cache directory '%s': %w", dir, err)
+	}
+	return dir, nil
+}
+
+// withFileLock runs fn with path opened for read/write, holding an
+// exclusive flock() on a sibling ".lock" file for the duration. This
+// mirrors the pattern Go's module fetcher uses (its internal lockedfile
+// package) to let several processes share the same cache directory
+// safely.
+func withFileLock(path string, fn func(*os.File) error) (err error) {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("can't open lock file: %w", err)
+	}
+	defer lock.Close()
+	if err = unix.Flock(int(lock.Fd()), unix.LOCK_EX); err != nil {
+		return fmt.Errorf("can't acquire lock: %w", err)
+	}
+	defer unix.Flock(int(lock.Fd()), unix.LOCK_UN)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("can't open '%s': %w", path, err)
+	}
+	defer f.Close()
+	return fn(f)
+}
+
+// cacheExternalBlockList persists rawBody (gzip-compressed) and state's
+// validators to disk so a restart does not force a cold re-download of
+// every external blocklist.
+func (c *Controller) cacheExternalBlockList(name string, rawBody []byte, state externalSourceState) error {
+	dir, err := xdgCacheDir()
+	if err != nil {
+		return err
+	}
+	payloadPath := filepath.Join(dir, name+".gz")
+	if err = withFileLock(payloadPath, func(f *os.File) error {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		compressor, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		if _, err = compressor.Write(rawBody); err != nil {
+			return err
+		}
+		return compressor.Close()
+	}); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(cachedExternalEntry{
+		ETag:         state.ETag,
+		LastModified: state.LastModified,
+		Hash:         state.Hash,
+	})
+	if err != nil {
+		return fmt.Errorf("can't marshal cache metadata: %w", err)
+	}
+	metaPath := filepath.Join(dir, name+".json")
+	return withFileLock(metaPath, func(f *os.File) error {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err = f.Write(meta)
+		return err
+	})
+}
+
+// loadCachedExternalBlockList restores name's previous successful fetch
+// from disk, returning ok == false if no cache is present or it can't be
+// read.
+func (c *Controller) loadCachedExternalBlockList(name string) (state externalSourceState, ok bool) {
+	dir, err := xdgCacheDir()
+	if err != nil {
+		c.logger.Errorf("[Updater] '%s': can't resolve cache directory: %v", name, err)
+		return externalSourceState{}, false
+	}
+	metaPath := filepath.Join(dir, name+".json")
+	metaBytes, err := os.ReadFile(metaPath)
+	if err != nil {
+		return externalSourceState{}, false
+	}
+	var entry cachedExternalEntry
+	if err = json.Unmarshal(metaBytes, &entry); err != nil {
+		c.logger.Errorf("[Updater] '%s': can't unmarshal cache metadata: %v", name, err)
+		return externalSourceState{}, false
+	}
+	payloadPath := filepath.Join(dir, name+".gz")
+	var body []byte
+	if err = withFileLock(payloadPath, func(f *os.File) (err error) {
+		decompressor, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer decompressor.Close()
+		body, err = io.ReadAll(decompressor)
+		return err
+	}); err != nil {
+		c.logger.Errorf("[Updater] '%s': can't read cached payload: %v", name, err)
+		return externalSourceState{}, false
+	}
+	records, err := parseExternalBlockList(name, body)
+	if err != nil {
+		c.logger.Errorf("[Updater] '%s': can't parse cached payload: %v", name, err)
+		return externalSourceState{}, false
+	}
+	c.logger.Infof("[Updater] '%s': restored %d range(s) from on-disk cache", name, len(records))
+	return externalSourceState{
+		Records:      records,
+		ETag:         entry.ETag,
+		LastModified: entry.LastModified,
+		Hash:         entry.Hash,
+	}, true
+}
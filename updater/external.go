@@ -0,0 +1,174 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hekmon/btblocklist/updater/format"
+)
+
+// externalSourceState tracks the validators from the previous successful
+// fetch of one external blocklist, used to short-circuit re-downloading
+// and re-parsing content that has not changed upstream.
+type externalSourceState struct {
+	Records      []format.Record
+	ETag         string
+	LastModified string
+	Hash         string
+}
+
+// getExternalBlockList fetches the blocklist called name at url, sending
+// the validators from the previous successful fetch (if any) so an
+// unchanged upstream list short-circuits on a 304 without being
+// re-parsed. changed reports true when the list content changed,
+// restoring the on-disk cache first if this is the first fetch of the
+// process lifetime: that first restore always counts as a change, even if
+// the upstream fetch then reports nothing new (a 304 or a hash match), so
+// a freshly started process renders the restored data at least once
+// instead of serving nothing until the list actually changes upstream. ok
+// reports whether the fetch itself succeeded, regardless of whether the
+// content changed, so callers can tell an upstream that simply hasn't
+// changed lately from one that is actually failing.
+func (c *Controller) getExternalBlockList(name, url string) (changed, ok bool) {
+	previous, known := c.externalStates[name]
+	restoredFromDisk := false
+	if !known {
+		if cached, ok := c.loadCachedExternalBlockList(name); ok {
+			previous, known = cached, true
+			c.externalStates[name] = cached
+			restoredFromDisk = true
+		}
+	}
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		c.logger.Errorf("[Updater] '%s': can't build request: %v", name, err)
+		return restoredFromDisk, false
+	}
+	if known {
+		if previous.ETag != "" {
+			req.Header.Set("If-None-Match", previous.ETag)
+		}
+		if previous.LastModified != "" {
+			req.Header.Set("If-Modified-Since", previous.LastModified)
+		}
+	}
+	fetchStart := time.Now()
+	resp, err := c.client.Do(req)
+	if c.metrics != nil {
+		c.metrics.SourceFetchDuration.WithLabelValues(name).Observe(time.Since(fetchStart).Seconds())
+	}
+	if err != nil {
+		c.logger.Errorf("[Updater] '%s': can't fetch blocklist: %v", name, err)
+		return restoredFromDisk, false
+	}
+	defer resp.Body.Close()
+	if c.metrics != nil {
+		c.metrics.SourceFetchStatus.WithLabelValues(name, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		c.logger.Debugf("[Updater] '%s': not modified since last fetch", name)
+		if c.metrics != nil {
+			c.metrics.CacheHits.Inc()
+		}
+		return restoredFromDisk, true
+	}
+	if resp.StatusCode != http.StatusOK {
+		c.logger.Errorf("[Updater] '%s': unexpected status code %d", name, resp.StatusCode)
+		return restoredFromDisk, false
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.logger.Errorf("[Updater] '%s': can't read response body: %v", name, err)
+		return restoredFromDisk, false
+	}
+	hash := sha256.Sum256(body)
+	hashHex := hex.EncodeToString(hash[:])
+	if known && previous.Hash == hashHex {
+		c.logger.Debugf("[Updater] '%s': content unchanged (hash match)", name)
+		if c.metrics != nil {
+			c.metrics.CacheHits.Inc()
+		}
+		return restoredFromDisk, true
+	}
+	records, err := parseExternalBlockList(name, body)
+	if err != nil {
+		c.logger.Errorf("[Updater] '%s': can't parse blocklist: %v", name, err)
+		return restoredFromDisk, false
+	}
+	state := externalSourceState{
+		Records:      records,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Hash:         hashHex,
+	}
+	c.externalStates[name] = state
+	if err = c.cacheExternalBlockList(name, body, state); err != nil {
+		c.logger.Errorf("[Updater] '%s': can't persist cache to disk: %v", name, err)
+	}
+	if c.metrics != nil {
+		c.metrics.CacheMisses.Inc()
+		c.metrics.SourceChanged.WithLabelValues(name).Inc()
+	}
+	return true, true
+}
+
+// parseExternalBlockList turns one external blocklist's raw, line based
+// body into Records labelled with the list's name. Each line is either a
+// bare CIDR or the native eMule/P2P "start-end" range; ranges are expanded
+// into the minimal covering set of CIDRs since every downstream Formatter
+// expects a CIDR. Blank lines and '#' comments are ignored.
+func parseExternalBlockList(name string, body []byte) (records []format.Record, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cidrs, err := externalLineToCIDRs(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %q: %w", line, err)
+		}
+		for _, cidr := range cidrs {
+			records = append(records, format.Record{Label: name, CIDR: cidr})
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// externalLineToCIDRs converts one line of an external blocklist into its
+// CIDR-expressible form, accepting either a bare CIDR or a "start-end"
+// range (the inverse of format.cidrToRange).
+func externalLineToCIDRs(line string) (cidrs []string, err error) {
+	if strings.Contains(line, "/") {
+		if _, _, err = net.ParseCIDR(line); err != nil {
+			return nil, fmt.Errorf("not a valid CIDR: %w", err)
+		}
+		return []string{line}, nil
+	}
+	start, end, found := strings.Cut(line, "-")
+	if !found {
+		return nil, fmt.Errorf("neither a CIDR nor a start-end range")
+	}
+	startIP := net.ParseIP(strings.TrimSpace(start))
+	endIP := net.ParseIP(strings.TrimSpace(end))
+	if startIP == nil || endIP == nil {
+		return nil, fmt.Errorf("invalid range endpoints")
+	}
+	v4 := startIP.To4() != nil
+	if v4 != (endIP.To4() != nil) {
+		return nil, fmt.Errorf("range endpoints are not the same address family")
+	}
+	return rangeToCIDRs(ipToInt(startIP), ipToInt(endIP), v4)
+}
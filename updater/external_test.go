@@ -0,0 +1,56 @@
+package updater
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExternalLineToCIDRs(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    []string
+		wantErr bool
+	}{
+		{"bare CIDR passes through", "1.2.3.0/24", []string{"1.2.3.0/24"}, false},
+		{"aligned range becomes a single CIDR", "1.2.3.0-1.2.3.255", []string{"1.2.3.0/24"}, false},
+		{"misaligned range splits into multiple CIDRs", "1.2.3.1-1.2.3.4", []string{"1.2.3.1/32", "1.2.3.2/31", "1.2.3.4/32"}, false},
+		{"single address range", "1.2.3.4-1.2.3.4", []string{"1.2.3.4/32"}, false},
+		{"ipv6 range", "::-::1", []string{"::/127"}, false},
+		{"invalid CIDR", "1.2.3.0/abc", nil, true},
+		{"invalid range endpoint", "1.2.3.4-not-an-ip", nil, true},
+		{"mixed address families", "1.2.3.4-::1", nil, true},
+		{"neither a CIDR nor a range", "1.2.3.4", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := externalLineToCIDRs(tt.line)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("externalLineToCIDRs(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("externalLineToCIDRs(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExternalBlockList(t *testing.T) {
+	body := []byte("# comment\n\n1.2.3.0/24\n10.0.0.0-10.0.0.1\n")
+	records, err := parseExternalBlockList("example", body)
+	if err != nil {
+		t.Fatalf("parseExternalBlockList() error = %v", err)
+	}
+	want := []string{"1.2.3.0/24", "10.0.0.0/31"}
+	if len(records) != len(want) {
+		t.Fatalf("parseExternalBlockList() = %v, want %d records", records, len(want))
+	}
+	for i, record := range records {
+		if record.Label != "example" {
+			t.Errorf("record[%d].Label = %q, want %q", i, record.Label, "example")
+		}
+		if record.CIDR != want[i] {
+			t.Errorf("record[%d].CIDR = %q, want %q", i, record.CIDR, want[i])
+		}
+	}
+}
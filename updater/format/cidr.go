@@ -0,0 +1,24 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// CIDR renders records as a plain list of CIDR ranges, one per line, with
+// no provenance information.
+type CIDR struct{}
+
+// Kind implements Formatter.
+func (CIDR) Kind() Kind { return KindCIDR }
+
+// Format implements Formatter.
+func (CIDR) Format(records []Record) (data []byte, err error) {
+	buf := bytes.NewBuffer(nil)
+	for _, record := range records {
+		if _, err = fmt.Fprintln(buf, record.CIDR); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
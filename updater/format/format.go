@@ -0,0 +1,71 @@
+// Package format renders the deduplicated IP range records gathered by the
+// updater as the various text formats its consumers expect (P2P
+// blocklists, plain CIDR lists, firewall restore scripts, JSON, ...).
+package format
+
+import "net"
+
+// Record is one IP range coming from RIPE or an external blocklist, already
+// resolved to a CIDR-expressible form.
+type Record struct {
+	Label string // provenance, e.g. "RIPE:some-org" or the external list name
+	CIDR  string // e.g. "1.2.3.0/24"
+}
+
+// Kind identifies one of the output formats this package can produce.
+type Kind string
+
+// Supported output formats.
+const (
+	KindP2P   Kind = "p2p"
+	KindCIDR  Kind = "cidr"
+	KindIPSet Kind = "ipset"
+	KindNFT   Kind = "nft"
+	KindJSON  Kind = "json"
+)
+
+// Formatter renders a set of Records as one of the supported output
+// formats.
+type Formatter interface {
+	Kind() Kind
+	Format(records []Record) (data []byte, err error)
+}
+
+// All returns one instance of every Formatter this package implements, in a
+// stable order. setName is used by the formatters (ipset, nft) that render
+// a named set.
+func All(setName string) []Formatter {
+	return []Formatter{
+		P2P{},
+		CIDR{},
+		IPSet{SetName: setName},
+		NFT{SetName: setName},
+		JSON{},
+	}
+}
+
+// isIPv4CIDR reports whether cidr is an IPv4 range, so formatters that need
+// a family-specific target (ipset sets, nft element types) can split their
+// output accordingly instead of mixing IPv4 and IPv6 in a single statement.
+func isIPv4CIDR(cidr string) (v4 bool, err error) {
+	ip, _, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return false, err
+	}
+	return ip.To4() != nil, nil
+}
+
+// cidrToRange expands a CIDR into its first and last IP, as required by the
+// eMule/P2P "name:start-end" format.
+func cidrToRange(cidr string) (start, end net.IP, err error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, nil, err
+	}
+	start = network.IP
+	end = make(net.IP, len(start))
+	for i := range start {
+		end[i] = start[i] | ^network.Mask[i]
+	}
+	return start, end, nil
+}
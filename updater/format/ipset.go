@@ -0,0 +1,48 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// IPSet renders records as an `ipset restore` script creating a hash:net
+// set if it does not exist yet and adding every range to it; an existing
+// set is not flushed, so entries already in it are kept. IPv4 and IPv6
+// ranges are split into two distinct sets (SetName and SetName+"6"), since
+// a single ipset hash:net set only accepts one address family.
+type IPSet struct {
+	SetName string
+}
+
+// Kind implements Formatter.
+func (f IPSet) Kind() Kind { return KindIPSet }
+
+// Format implements Formatter.
+func (f IPSet) Format(records []Record) (data []byte, err error) {
+	buf := bytes.NewBuffer(nil)
+	var wroteV4Header, wroteV6Header bool
+	for _, record := range records {
+		v4, err := isIPv4CIDR(record.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("can't determine the address family of %q: %w", record.CIDR, err)
+		}
+		setName, family, wrote := f.SetName, "inet", wroteV4Header
+		if !v4 {
+			setName, family, wrote = f.SetName+"6", "inet6", wroteV6Header
+		}
+		if !wrote {
+			if _, err = fmt.Fprintf(buf, "create %s hash:net family %s -exist\n", setName, family); err != nil {
+				return nil, err
+			}
+			if v4 {
+				wroteV4Header = true
+			} else {
+				wroteV6Header = true
+			}
+		}
+		if _, err = fmt.Fprintf(buf, "add %s %s\n", setName, record.CIDR); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
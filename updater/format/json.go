@@ -0,0 +1,23 @@
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSON renders records as a JSON array, for monitoring pipelines and other
+// machine consumers that would rather not parse text formats.
+type JSON struct{}
+
+// Kind implements Formatter.
+func (JSON) Kind() Kind { return KindJSON }
+
+// Format implements Formatter.
+func (JSON) Format(records []Record) (data []byte, err error) {
+	buf := bytes.NewBuffer(nil)
+	encoder := json.NewEncoder(buf)
+	if err = encoder.Encode(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
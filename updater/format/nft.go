@@ -0,0 +1,36 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// NFT renders records as `nft add element` statements loading every range
+// into an existing named set. IPv4 and IPv6 ranges are split into two
+// distinct sets (SetName and SetName+"6"), since a single nft set element
+// type can't hold both address families.
+type NFT struct {
+	SetName string
+}
+
+// Kind implements Formatter.
+func (f NFT) Kind() Kind { return KindNFT }
+
+// Format implements Formatter.
+func (f NFT) Format(records []Record) (data []byte, err error) {
+	buf := bytes.NewBuffer(nil)
+	for _, record := range records {
+		v4, err := isIPv4CIDR(record.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("can't determine the address family of %q: %w", record.CIDR, err)
+		}
+		setName := f.SetName
+		if !v4 {
+			setName += "6"
+		}
+		if _, err = fmt.Fprintf(buf, "add element inet filter %s { %s }\n", setName, record.CIDR); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,28 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// P2P renders records in the eMule/P2P "name:start-end" text format, one
+// range per line. This is the format the daemon has always produced.
+type P2P struct{}
+
+// Kind implements Formatter.
+func (P2P) Kind() Kind { return KindP2P }
+
+// Format implements Formatter.
+func (P2P) Format(records []Record) (data []byte, err error) {
+	buf := bytes.NewBuffer(nil)
+	for _, record := range records {
+		start, end, err := cidrToRange(record.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("can't render %q as a P2P range: %w", record.CIDR, err)
+		}
+		if _, err = fmt.Fprintf(buf, "%s:%s-%s\n", record.Label, start, end); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
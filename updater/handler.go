@@ -0,0 +1,53 @@
+package updater
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hekmon/btblocklist/updater/format"
+	"github.com/hekmon/btblocklist/updater/metrics"
+)
+
+// defaultFormat is served when the client does not request a specific one,
+// preserving the daemon's historical P2P-only behavior.
+const defaultFormat = format.KindP2P
+
+// ServeHTTP delivers the current cached blocklist blob in the format asked
+// for by the "format" query parameter (defaulting to the P2P format), picking
+// the compression variant that best matches the client's Accept-Encoding
+// header and setting Content-Encoding accordingly.
+func (c *Controller) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kind := format.Kind(r.URL.Query().Get("format"))
+	if kind == "" {
+		kind = defaultFormat
+	}
+	body, encoding, err := c.GetEncoded(kind, r.Header.Get("Accept-Encoding"))
+	if err != nil {
+		c.logger.Errorf("[Updater] Can't serve data: %v", err)
+		http.Error(w, "no data available yet", http.StatusServiceUnavailable)
+		return
+	}
+	defer body.Close()
+	if encoding != EncodingIdentity {
+		w.Header().Set("Content-Encoding", string(encoding))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err = io.Copy(w, body); err != nil {
+		c.logger.Errorf("[Updater] Can't stream response body: %v", err)
+	}
+}
+
+// Mux builds the HTTP mux the main binary should listen with: "/" serves
+// the blocklist (see ServeHTTP), and, when metrics were configured on the
+// Controller, "/metrics" serves the Prometheus registry and "/healthz"
+// reports on cache staleness (a batch older than maxStale).
+func (c *Controller) Mux(maxStale time.Duration) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/", c)
+	if c.metrics != nil {
+		mux.Handle("/metrics", c.metrics.Handler())
+		mux.Handle("/healthz", metrics.HealthHandler(c.LastSuccess, maxStale))
+	}
+	return mux
+}
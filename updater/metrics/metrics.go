@@ -0,0 +1,127 @@
+// Package metrics exposes the updater subsystem's Prometheus registry and
+// the HTTP handlers serving /metrics and /healthz.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics groups every Prometheus collector the updater subsystem reports.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	BatchDuration       prometheus.Histogram
+	SourceFetchDuration *prometheus.HistogramVec
+	SourceFetchStatus   *prometheus.CounterVec
+	SourceLineCount     *prometheus.GaugeVec
+	SourceChanged       *prometheus.CounterVec
+	RIPEQueryDuration   prometheus.Histogram
+	CompressedSize      *prometheus.GaugeVec
+	UncompressedSize    prometheus.Gauge
+	CacheHits           prometheus.Counter
+	CacheMisses         prometheus.Counter
+}
+
+// New creates and registers every collector on a fresh registry.
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		BatchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "batch_duration_seconds",
+			Help:      "Duration of a full update batch (probing every source, coalescing and rendering).",
+		}),
+		SourceFetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "source_fetch_duration_seconds",
+			Help:      "Duration of fetching one external blocklist source.",
+		}, []string{"source"}),
+		SourceFetchStatus: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "source_fetch_status_total",
+			Help:      "HTTP status codes observed fetching each external source.",
+		}, []string{"source", "status"}),
+		SourceLineCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "source_lines",
+			Help:      "Number of ranges currently cached for a source.",
+		}, []string{"source"}),
+		SourceChanged: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "source_changed_total",
+			Help:      "Batches where a source's content changed since the previous batch.",
+		}, []string{"source"}),
+		RIPEQueryDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "ripe_query_duration_seconds",
+			Help:      "Duration of the RIPE search query.",
+		}),
+		CompressedSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "compressed_size_bytes",
+			Help:      "Size of the cached payload for a given format/encoding pair.",
+		}, []string{"format", "encoding"}),
+		UncompressedSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "uncompressed_size_bytes",
+			Help:      "Size of the merged, uncompressed blocklist.",
+		}),
+		CacheHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "conditional_fetch_cache_hits_total",
+			Help:      "External fetches short-circuited by a 304 or an unchanged content hash.",
+		}),
+		CacheMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "btblocklist",
+			Subsystem: "updater",
+			Name:      "conditional_fetch_cache_misses_total",
+			Help:      "External fetches that downloaded a changed payload.",
+		}),
+	}
+	m.Registry.MustRegister(
+		m.BatchDuration,
+		m.SourceFetchDuration,
+		m.SourceFetchStatus,
+		m.SourceLineCount,
+		m.SourceChanged,
+		m.RIPEQueryDuration,
+		m.CompressedSize,
+		m.UncompressedSize,
+		m.CacheHits,
+		m.CacheMisses,
+	)
+	return m
+}
+
+// Handler serves /metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// HealthHandler serves /healthz: it reports 200 while lastBatch() is no
+// older than maxStale, and 503 otherwise (a stale cache, usually meaning
+// the updater loop is stuck or every source fetch is failing).
+func HealthHandler(lastBatch func() time.Time, maxStale time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		age := time.Since(lastBatch())
+		if age > maxStale {
+			http.Error(w, fmt.Sprintf("stale cache: last batch was %v ago (max %v)", age.Round(time.Second), maxStale), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "ok: last batch %v ago\n", age.Round(time.Second))
+	})
+}
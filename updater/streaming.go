@@ -0,0 +1,110 @@
+package updater
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// streamingThreshold is the payload size above which a cached variant is
+// spilled to a memory-mapped temp file instead of living fully in the Go
+// heap. Aggregate blocklists can run into the tens of megabytes.
+const streamingThreshold = 8 * 1024 * 1024 // 8 MiB
+
+// bufferPool and gzipWriterPool hold the intermediate buffers used while
+// building a batch's variants, avoiding a fresh allocation per source per
+// batch.
+var bufferPool = sync.Pool{
+	New: func() any { return bytes.NewBuffer(nil) },
+}
+
+var gzipWriterPool = sync.Pool{
+	New: func() any {
+		compressor, _ := gzip.NewWriterLevel(io.Discard, gzip.BestCompression)
+		return compressor
+	},
+}
+
+// cachedBlob is one compression variant as stored in
+// Controller.encodedVariants: either held fully in memory, or spilled to a
+// temp file once it grows past streamingThreshold so readers can stream it
+// back via a memory mapping instead of holding a second copy on the heap.
+type cachedBlob struct {
+	inMemory []byte
+	filePath string
+	size     int
+}
+
+// newCachedBlob takes ownership of data, spilling it to a temp file when
+// it is larger than streamingThreshold.
+func newCachedBlob(data []byte) (blob cachedBlob, err error) {
+	if len(data) <= streamingThreshold {
+		return cachedBlob{inMemory: data, size: len(data)}, nil
+	}
+	f, err := os.CreateTemp("", "btblocklist-*.blob")
+	if err != nil {
+		return cachedBlob{}, fmt.Errorf("can't create spill file: %w", err)
+	}
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return cachedBlob{}, fmt.Errorf("can't write spill file: %w", err)
+	}
+	return cachedBlob{filePath: f.Name(), size: len(data)}, nil
+}
+
+// reader opens a fresh, independent io.ReadCloser over the blob: a pooled
+// buffer for in-memory blobs, or a new memory mapping of the spill file for
+// large ones. Several readers can be open on the same cachedBlob at once.
+func (b cachedBlob) reader() (io.ReadCloser, error) {
+	if b.filePath == "" {
+		buf := bufferPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		buf.Write(b.inMemory)
+		return &pooledReader{Reader: bytes.NewReader(buf.Bytes()), buf: buf}, nil
+	}
+	f, err := os.Open(b.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("can't open spill file '%s': %w", b.filePath, err)
+	}
+	defer f.Close()
+	mapped, err := unix.Mmap(int(f.Fd()), 0, b.size, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, fmt.Errorf("can't mmap spill file '%s': %w", b.filePath, err)
+	}
+	return &mmapReader{Reader: bytes.NewReader(mapped), mapped: mapped}, nil
+}
+
+// cleanup removes the spill file backing b, if any. Called once the blob
+// is evicted from Controller.encodedVariants by a fresh batch.
+func (b cachedBlob) cleanup() {
+	if b.filePath != "" {
+		os.Remove(b.filePath)
+	}
+}
+
+// pooledReader returns its backing buffer to bufferPool on Close.
+type pooledReader struct {
+	*bytes.Reader
+	buf *bytes.Buffer
+}
+
+func (p *pooledReader) Close() error {
+	bufferPool.Put(p.buf)
+	return nil
+}
+
+// mmapReader unmaps its backing memory mapping on Close.
+type mmapReader struct {
+	*bytes.Reader
+	mapped []byte
+}
+
+func (m *mmapReader) Close() error {
+	return unix.Munmap(m.mapped)
+}
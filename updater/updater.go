@@ -1,13 +1,11 @@
 package updater
 
 import (
-	"bytes"
-	"compress/gzip"
 	"fmt"
-	"io"
-	"strings"
+	"net"
 	"time"
 
+	"github.com/hekmon/btblocklist/updater/format"
 	"github.com/hekmon/cunits/v2"
 )
 
@@ -36,85 +34,152 @@ func (c *Controller) updaterBatch() {
 	c.logger.Debug("[Updater] worker: starting a new batch")
 	batchStart := time.Now()
 	defer func() {
-		c.lastBatch = batchStart
 		var externalLines int
-		for _, lines := range c.externalStates {
-			externalLines += len(lines)
+		for _, state := range c.externalStates {
+			externalLines += len(state.Records)
 		}
-		c.updateStatus(len(c.ripeState), len(c.externalStates), externalLines, c.lastUpdate, c.lastBatch)
+		c.batchStateAccess.RLock()
+		lastUpdate, lastBatch := c.lastUpdate, c.lastBatch
+		c.batchStateAccess.RUnlock()
+		c.updateStatus(len(c.ripeState), len(c.externalStates), externalLines, lastUpdate, lastBatch)
+		c.instrumentBatch(time.Since(batchStart))
 	}()
 	// Probing
-	ripeUpdate := c.updateRipe()
-	var externalUpdate bool
+	ripeChanged, ripeOK := c.updateRipe()
+	var externalChanged, externalOK bool
 	for name, url := range c.blocklists {
-		if c.getExternalBlockList(name, url.String()) {
-			externalUpdate = true
+		changed, ok := c.getExternalBlockList(name, url.String())
+		if changed {
+			externalChanged = true
 		}
+		if ok {
+			externalOK = true
+		}
+	}
+	c.batchStateAccess.Lock()
+	c.lastBatch = batchStart
+	if ripeOK || externalOK {
+		c.lastSuccess = batchStart
 	}
+	c.batchStateAccess.Unlock()
 	// Global update
-	if !ripeUpdate && !externalUpdate {
+	if !ripeChanged && !externalChanged {
 		c.logger.Info("[Updater] No new data, keeping cache")
 		return
 	}
-	data := c.compileFinalDataBlobFromCache()
-	if data == nil {
+	blobs := c.compileFinalDataBlobFromCache()
+	if len(blobs) == 0 {
+		c.logger.Errorf("[Updater] every formatter failed this batch, keeping previous cache")
 		return
 	}
-	// Update the current data
+	// Merge the freshly rendered formats into the raw cache, leaving any
+	// format that failed to render this round (see
+	// compileFinalDataBlobFromCache) serving its last good blob instead of
+	// going stale for every format at once. Only the compression variants
+	// of the formats that actually changed are dropped (and their spill
+	// files, if any, removed) so GetEncoded() rebuilds just those lazily.
+	var stale []cachedBlob
 	c.compressedDataAccess.Lock()
-	c.compressedData = data
+	for kind, data := range blobs {
+		c.rawData[kind] = data
+		for _, blob := range c.encodedVariants[kind] {
+			stale = append(stale, blob)
+		}
+		delete(c.encodedVariants, kind)
+	}
 	c.compressedDataAccess.Unlock()
+	for _, blob := range stale {
+		blob.cleanup()
+	}
+	c.batchStateAccess.Lock()
 	c.lastUpdate = batchStart
+	c.batchStateAccess.Unlock()
 	c.logger.Debug("[Updater] global cache updated")
 }
 
-func (c *Controller) compileFinalDataBlobFromCache() (data []byte) {
+// compileFinalDataBlobFromCache merges the RIPE and external range records
+// currently in cache and renders them through every configured Formatter,
+// producing one raw (uncompressed) blob per output format.
+func (c *Controller) compileFinalDataBlobFromCache() (blobs map[format.Kind][]byte) {
 	startCompress := time.Now()
-	c.logger.Info("[Updater] Merging and compressing all cached results")
-	// Prepare the compressor
-	compressed := bytes.NewBuffer(nil)
-	compressor, err := gzip.NewWriterLevel(compressed, gzip.BestCompression)
-	if err != nil {
-		c.logger.Errorf("[Updater] Can't create the gzip compressor: %v", err)
-		return
+	c.logger.Info("[Updater] Merging all cached results and rendering output formats")
+	// Merge the RIPE and external records into a single slice
+	records := make([]format.Record, 0, len(c.ripeState))
+	records = append(records, c.ripeState...)
+	var externalLines int
+	for _, state := range c.externalStates {
+		externalLines += len(state.Records)
+		records = append(records, state.Records...)
 	}
-	// Add the ripe data
-	if _, err = compressor.Write([]byte("# BTBlocklist RIPE search\n")); err != nil {
-		c.logger.Errorf("[Updater] Can't write RIPE search header: %v", err)
-		return
+	// Coalesce overlapping/adjacent ranges across every source into their
+	// minimal covering set, unless the operator opted out to keep
+	// per-source provenance.
+	if !c.disableCoalescing {
+		before := len(records)
+		coalesced, err := coalesceRecords(records)
+		if err != nil {
+			c.logger.Errorf("[Updater] Can't coalesce ranges: %v", err)
+		} else {
+			records = coalesced
+			c.logger.Infof("[Updater] Coalesced %d range(s) into %d", before, len(records))
+		}
 	}
-	ripeReader := bytes.NewBufferString(strings.Join(c.ripeState, "\n"))
-	if _, err = io.Copy(compressor, ripeReader); err != nil {
-		c.logger.Errorf("[Updater] Can't copy ripe results to the compressor: %v", err)
-		return
+	// Drop any record a formatter can't turn into output (e.g. a malformed
+	// CIDR from an external source) instead of letting it poison every
+	// format below.
+	records = dropInvalidRecords(records, c.logger)
+	// Render each configured format. A formatter failing on this batch only
+	// loses that one format for this round: the others still get their
+	// fresh render, and updaterBatch keeps serving the previous cache entry
+	// for the failed format until it succeeds again.
+	blobs = make(map[format.Kind][]byte, len(c.formatters))
+	for _, formatter := range c.formatters {
+		data, err := formatter.Format(records)
+		if err != nil {
+			c.logger.Errorf("[Updater] Can't render the '%s' format: %v", formatter.Kind(), err)
+			continue
+		}
+		blobs[formatter.Kind()] = data
 	}
-	if _, err = compressor.Write([]byte("\n")); err != nil {
-		c.logger.Errorf("[Updater] Can't add \\n after RIPE results: %v", err)
-		return
+	var totalSize int
+	for _, blob := range blobs {
+		totalSize += len(blob)
 	}
-	// Add the external data
-	var externalLines int
-	for name, lines := range c.externalStates {
-		externalLines += len(lines)
-		externalReader := bytes.NewBufferString(strings.Join(lines, "\n"))
-		if _, err = io.Copy(compressor, externalReader); err != nil {
-			c.logger.Errorf("[Updater] Can't copy '%s' results to the compressor: %v", name, err)
-			return
-		}
-		if _, err = compressor.Write([]byte("\n")); err != nil {
-			c.logger.Errorf("[Updater] Can't add \\n after '%s' results: %v", name, err)
-			return
+	if c.metrics != nil {
+		c.metrics.UncompressedSize.Set(float64(totalSize))
+	}
+	c.logger.Infof("[Updater] %d range(s) from RIPE search and %d line(s) from %d external blocklist(s) rendered into %d format(s) (%s total) in %v",
+		len(c.ripeState), externalLines, len(c.externalStates), len(blobs), cunits.ImportInByte(float64(totalSize)), time.Since(startCompress))
+	return
+}
+
+// dropInvalidRecords filters out any record whose CIDR a Formatter cannot
+// be expected to render, logging each one dropped. This keeps one
+// malformed record (e.g. from a misbehaving external source) from failing
+// every configured format for the whole batch.
+func dropInvalidRecords(records []format.Record, logger Logger) []format.Record {
+	valid := records[:0]
+	for _, record := range records {
+		if _, _, err := net.ParseCIDR(record.CIDR); err != nil {
+			logger.Errorf("[Updater] dropping record %q (%s): not a valid CIDR: %v", record.Label, record.CIDR, err)
+			continue
 		}
+		valid = append(valid, record)
 	}
-	// Finalize
-	if err = compressor.Close(); err != nil {
-		c.logger.Errorf("[Updater] Can't flush remaining bytes from the gzip compressor: %v", err)
+	return valid
+}
+
+// instrumentBatch reports a completed batch's duration and per-source line
+// counts to the optional Prometheus registry (a no-op if none was
+// configured).
+func (c *Controller) instrumentBatch(batchDuration time.Duration) {
+	if c.metrics == nil {
 		return
 	}
-	data = compressed.Bytes()
-	c.logger.Infof("[Updater] %d range(s) from RIPE search and %d line(s) from %d external blocklist(s) compressed to %s in %v",
-		len(c.ripeState), externalLines, len(c.externalStates), cunits.ImportInByte(float64(len(data))), time.Since(startCompress))
-	return
+	c.metrics.BatchDuration.Observe(batchDuration.Seconds())
+	for name, state := range c.externalStates {
+		c.metrics.SourceLineCount.WithLabelValues(name).Set(float64(len(state.Records)))
+	}
 }
 
 func (c *Controller) updateStatus(nbRIPEranges, nbLists, nbLines int, lstModif, lstBatch time.Time) {